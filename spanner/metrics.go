@@ -36,6 +36,16 @@ import (
 const (
 	builtInMetricsMeterName = "gax-go"
 
+	// spannerEmulatorHostEnvVar, when set, indicates that the client is
+	// talking to the Spanner emulator and built-in metrics should not be
+	// exported.
+	spannerEmulatorHostEnvVar = "SPANNER_EMULATOR_HOST"
+
+	// disableBuiltinMetricsEnvVar lets users opt out of built-in metrics
+	// entirely, e.g. on private-service-connect or air-gapped setups where
+	// the client cannot reach the monitoring exporter.
+	disableBuiltinMetricsEnvVar = "SPANNER_DISABLE_BUILT_IN_METRICS"
+
 	nativeMetricsPrefix = "spanner.googleapis.com/internal/client/"
 	// Monitored resource labels
 	monitoredResLabelKeyProject        = "project_id"
@@ -53,10 +63,13 @@ const (
 	metricLabelKeyDirectPathUsed    = "directpath_used"
 
 	// Metric names
-	metricNameOperationLatencies = "operation_latencies"
-	metricNameAttemptLatencies   = "attempt_latencies"
-	metricNameOperationCount     = "operation_count"
-	metricNameAttemptCount       = "attempt_count"
+	metricNameOperationLatencies    = "operation_latencies"
+	metricNameAttemptLatencies      = "attempt_latencies"
+	metricNameOperationCount        = "operation_count"
+	metricNameAttemptCount          = "attempt_count"
+	metricNameGFELatencies          = "gfe_latencies"
+	metricNameAFELatencies          = "afe_latencies"
+	metricNameGFEMissingHeaderCount = "gfe_missing_header_count"
 )
 
 var (
@@ -79,6 +92,14 @@ var (
 	exporterOpts = []option.ClientOption{}
 )
 
+// boolEnvVar reports whether the named environment variable is set to a
+// truthy value, as understood by strconv.ParseBool. An unset or unparseable
+// value is treated as false.
+func boolEnvVar(name string) bool {
+	v, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && v
+}
+
 // MetricsProvider is a wrapper for built in metrics meter provider
 type MetricsProvider interface {
 	isMetricsProvider()
@@ -96,6 +117,16 @@ type CustomOpenTelemetryMetricsProvider struct {
 
 func (CustomOpenTelemetryMetricsProvider) isMetricsProvider() {}
 
+// MetricsProviderForTest builds a meter provider around an
+// sdkmetric.ManualReader instead of the periodic reader newBuiltinMetricsTracerFactory
+// would otherwise create, so tests can flush and inspect built-in metrics on
+// demand instead of waiting out defaultSamplePeriod.
+type MetricsProviderForTest struct {
+	Reader *sdkmetric.ManualReader
+}
+
+func (MetricsProviderForTest) isMetricsProvider() {}
+
 // createBuiltInMeterProviderOptions returns meter provider options, shutdown function and error
 func createBuiltInMeterProviderOptions(ctx context.Context, project string) (sdkmetric.Option, error) {
 	defaultExporter, err := newMonitoringExporter(ctx, project, exporterOpts...)
@@ -121,13 +152,80 @@ type builtinMetricsFactory struct {
 	// do not change across different function calls on client
 	clientAttributes []attribute.KeyValue
 
+	// directPathEnabled records whether the client was configured to attempt
+	// DirectPath, independent of whether any given attempt actually used it.
+	directPathEnabled bool
+
 	operationLatencies metric.Float64Histogram
 	attemptLatencies   metric.Float64Histogram
 	operationCount     metric.Int64Counter
 	attemptCount       metric.Int64Counter
+
+	// gfeLatencies and afeLatencies record the portion of an attempt's
+	// latency spent behind Google's and Google API's front ends, parsed
+	// from the server-timing response trailer. gfeMissingHeaderCount tracks
+	// attempts whose response carried no server-timing header, or one with
+	// neither a GFE nor an AFE entry, so a missing GFE hop can be told apart
+	// from a fast one.
+	gfeLatencies          metric.Float64Histogram
+	afeLatencies          metric.Float64Histogram
+	gfeMissingHeaderCount metric.Int64Counter
+}
+
+// SetDirectPathEnabled records whether the client was configured to attempt
+// DirectPath, so that it can be reported via the metricLabelKeyDirectPathEnabled
+// label on attempt and operation metrics.
+func (mf *builtinMetricsFactory) SetDirectPathEnabled(enabled bool) {
+	mf.directPathEnabled = enabled
 }
 
-func newBuiltinMetricsTracerFactory(ctx context.Context, project, instance, instanceConfig string, metricsProvider MetricsProvider) (*builtinMetricsFactory, error) {
+// directPathAttributes returns the directpath_enabled/directpath_used
+// attribute pair for the attempt tracked by ot, based on the peer address
+// UnaryInterceptor or StreamClientInterceptor captured for it. ot may be nil, e.g. for callers that
+// don't go through the gRPC interceptor chain, in which case
+// directpath_used is reported as false.
+func (mf *builtinMetricsFactory) directPathAttributes(ot *operationTracker) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Bool(metricLabelKeyDirectPathEnabled, mf.directPathEnabled),
+		attribute.Bool(metricLabelKeyDirectPathUsed, directPathUsedForAttempt(ot)),
+	}
+}
+
+// RecordAttempt ends the attempt tracked by ot and records its latency and
+// count. ctx should be the context returned by ot.startAttempt, so that its
+// attached span (if tracing is enabled) lets the OTel SDK attach an
+// exemplar linking this latency sample back to the trace.
+func (mf *builtinMetricsFactory) RecordAttempt(ctx context.Context, ot *operationTracker, method string, err error, now time.Time) {
+	latency := ot.endAttempt(now)
+	if !mf.builtinEnabled {
+		return
+	}
+	attrs := append(mf.attemptStatusAttributes(method, err), mf.directPathAttributes(ot)...)
+	mf.attemptLatencies.Record(ctx, float64(latency.Milliseconds()), metric.WithAttributes(attrs...))
+	mf.attemptCount.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// RecordOperation ends the operation tracked by ot and records its latency
+// and count. The number of attempts the operation took is not recorded.
+func (mf *builtinMetricsFactory) RecordOperation(ctx context.Context, ot *operationTracker, method string, err error, now time.Time) {
+	latency := ot.endOperation(now)
+	if !mf.builtinEnabled {
+		return
+	}
+	attrs := append(mf.attemptStatusAttributes(method, err), mf.directPathAttributes(ot)...)
+	mf.operationLatencies.Record(ctx, float64(latency.Milliseconds()), metric.WithAttributes(attrs...))
+	mf.operationCount.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// newBuiltinMetricsTracerFactory creates a factory for recording built-in
+// metrics. disableBuiltinMetrics is meant to be fed by a
+// SpannerOptions.DisableBuiltinMetrics field, but the client construction
+// code that would define that field and thread it through here is out of
+// scope for this package slice, so for now disableBuiltinMetrics is only
+// exercised directly from tests. Like the SPANNER_DISABLE_BUILT_IN_METRICS
+// and SPANNER_EMULATOR_HOST environment variables, it is ignored when the
+// caller passes an explicit CustomOpenTelemetryMetricsProvider.
+func newBuiltinMetricsTracerFactory(ctx context.Context, project, instance, instanceConfig string, disableBuiltinMetrics bool, metricsProvider MetricsProvider) (*builtinMetricsFactory, error) {
 	clientUID, err := generateClientUID()
 	if err != nil {
 		log.Printf("built-in metrics: generateClientUID failed: %v. Using empty string in the %v metric atteribute", err, metricLabelKeyClientUID)
@@ -145,9 +243,20 @@ func newBuiltinMetricsTracerFactory(ctx context.Context, project, instance, inst
 		shutdown: func() {},
 	}
 
-	if emulatorAddr := os.Getenv("BIGTABLE_EMULATOR_HOST"); emulatorAddr != "" {
-		// Do not emit metrics when emulator is being used
-		return metricsFactory, nil
+	// A user-supplied provider is an explicit choice and always wins over
+	// the auto-detected defaults below, whether that means always exporting
+	// (CustomOpenTelemetryMetricsProvider, MetricsProviderForTest) or never
+	// exporting (NoopMetricsProvider).
+	switch metricsProvider.(type) {
+	case CustomOpenTelemetryMetricsProvider, MetricsProviderForTest:
+	default:
+		if disableBuiltinMetrics || boolEnvVar(disableBuiltinMetricsEnvVar) {
+			return metricsFactory, nil
+		}
+		if emulatorAddr := os.Getenv(spannerEmulatorHostEnvVar); emulatorAddr != "" {
+			// Do not emit metrics when the Spanner emulator is being used.
+			return metricsFactory, nil
+		}
 	}
 
 	var meterProvider *sdkmetric.MeterProvider
@@ -167,6 +276,11 @@ func newBuiltinMetricsTracerFactory(ctx context.Context, project, instance, inst
 			// User provided meter provider
 			metricsFactory.builtinEnabled = true
 			meterProvider = v.MeterProvider
+		case MetricsProviderForTest:
+			// Meter provider backed by a manual reader the test controls.
+			metricsFactory.builtinEnabled = true
+			meterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(v.Reader))
+			metricsFactory.shutdown = func() { meterProvider.Shutdown(ctx) }
 		case NoopMetricsProvider:
 			metricsFactory.builtinEnabled = false
 			return metricsFactory, nil
@@ -218,5 +332,36 @@ func (mf *builtinMetricsFactory) createInstruments(meter metric.Meter) error {
 		nativeMetricsPrefix+metricNameAttemptCount,
 		metric.WithDescription("The number of additional RPCs sent after the initial attempt."),
 	)
+	if err != nil {
+		return err
+	}
+
+	// Create gfe_latencies
+	mf.gfeLatencies, err = meter.Float64Histogram(
+		nativeMetricsPrefix+metricNameGFELatencies,
+		metric.WithDescription("Latency between Google's network receiving an RPC and reading back the first byte of the response, as reported by the server-timing trailer."),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(bucketBounds...),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Create afe_latencies
+	mf.afeLatencies, err = meter.Float64Histogram(
+		nativeMetricsPrefix+metricNameAFELatencies,
+		metric.WithDescription("Latency added by the Spanner API front end, as reported by the server-timing trailer."),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(bucketBounds...),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Create gfe_missing_header_count
+	mf.gfeMissingHeaderCount, err = meter.Int64Counter(
+		nativeMetricsPrefix+metricNameGFEMissingHeaderCount,
+		metric.WithDescription("Number of attempts whose response carried no server-timing header, or one with neither a GFE nor an AFE entry, so a missing GFE hop can be told apart from a fast one."),
+	)
 	return err
 }
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"fmt"
+	"net"
+)
+
+// IP ranges that DirectPath traffic is served from. Any RPC whose peer
+// address falls inside one of these ranges reached Spanner over DirectPath
+// rather than through the regular gRPC path.
+const (
+	directPathIPV4Range = "34.126.0.0/18"
+	directPathIPV6Range = "2001:4860:8040::/42"
+)
+
+var (
+	directPathIPV4Net = mustParseCIDR(directPathIPV4Range)
+	directPathIPV6Net = mustParseCIDR(directPathIPV6Range)
+)
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(fmt.Sprintf("spanner: invalid DirectPath CIDR %q: %v", cidr, err))
+	}
+	return ipNet
+}
+
+// isDirectPathRemoteAddress reports whether addr belongs to one of the known
+// DirectPath IP ranges.
+func isDirectPathRemoteAddress(addr net.Addr) bool {
+	if addr == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		// addr may not have a port, e.g. bufconn or some resolver-supplied addresses.
+		host = addr.String()
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return directPathIPV4Net.Contains(ip) || directPathIPV6Net.Contains(ip)
+}
+
+// directPathUsedForAttempt reports whether the attempt tracked by ot was
+// actually served over DirectPath. The peer address it inspects is captured
+// by UnaryInterceptor or StreamClientInterceptor via the grpc.Peer call
+// option, since gRPC-go does not attach the remote peer to a client call's
+// context the way it does on the server side — peer.FromContext on an
+// outgoing client context never finds anything.
+func directPathUsedForAttempt(ot *operationTracker) bool {
+	if ot == nil || ot.attemptPeerAddr == nil {
+		return false
+	}
+	return isDirectPathRemoteAddress(ot.attemptPeerAddr)
+}
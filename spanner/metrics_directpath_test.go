@@ -0,0 +1,203 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestIsDirectPathRemoteAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		addr net.Addr
+		want bool
+	}{
+		{
+			name: "DirectPath IPv4",
+			addr: &net.TCPAddr{IP: net.ParseIP("34.126.12.34"), Port: 443},
+			want: true,
+		},
+		{
+			name: "DirectPath IPv6",
+			addr: &net.TCPAddr{IP: net.ParseIP("2001:4860:8040::1"), Port: 443},
+			want: true,
+		},
+		{
+			name: "non DirectPath IPv4",
+			addr: &net.TCPAddr{IP: net.ParseIP("142.250.0.1"), Port: 443},
+			want: false,
+		},
+		{
+			name: "loopback",
+			addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 443},
+			want: false,
+		},
+		{
+			name: "nil addr",
+			addr: nil,
+			want: false,
+		},
+	} {
+		if got := isDirectPathRemoteAddress(tc.addr); got != tc.want {
+			t.Errorf("%s: isDirectPathRemoteAddress(%v) = %v, want %v", tc.name, tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestDirectPathUsedForAttempt(t *testing.T) {
+	if directPathUsedForAttempt(nil) {
+		t.Errorf("directPathUsedForAttempt(nil) = true, want false")
+	}
+
+	ot := &operationTracker{attemptPeerAddr: &net.TCPAddr{IP: net.ParseIP("34.126.1.1"), Port: 443}}
+	if !directPathUsedForAttempt(ot) {
+		t.Errorf("directPathUsedForAttempt(ot) with DirectPath peer = false, want true")
+	}
+
+	ot.attemptPeerAddr = &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 443}
+	if directPathUsedForAttempt(ot) {
+		t.Errorf("directPathUsedForAttempt(ot) with loopback peer = true, want false")
+	}
+}
+
+func TestBuiltinMetricsFactoryDirectPathAttributes(t *testing.T) {
+	mf := &builtinMetricsFactory{}
+	mf.SetDirectPathEnabled(true)
+
+	ot := &operationTracker{attemptPeerAddr: &net.TCPAddr{IP: net.ParseIP("34.126.1.1"), Port: 443}}
+	attrs := mf.directPathAttributes(ot)
+	if len(attrs) != 2 {
+		t.Fatalf("directPathAttributes returned %d attributes, want 2", len(attrs))
+	}
+	if got := attrs[0].Value.AsBool(); !got {
+		t.Errorf("%s = %v, want true", metricLabelKeyDirectPathEnabled, got)
+	}
+	if got := attrs[1].Value.AsBool(); !got {
+		t.Errorf("%s = %v, want true", metricLabelKeyDirectPathUsed, got)
+	}
+}
+
+// directPathTestAddr masquerades as a DirectPath server address.
+// fakeRemoteAddrConn returns it as the RemoteAddr of a real net.Conn (from
+// bufconn, since real DirectPath ranges can't be bound to in a test
+// environment) so gRPC's insecure transport reports this
+// address as the RPC's peer, exactly as it would for a genuine DirectPath
+// connection.
+type directPathTestAddr struct{}
+
+func (directPathTestAddr) Network() string { return "tcp" }
+func (directPathTestAddr) String() string  { return "34.126.1.1:443" }
+
+type fakeRemoteAddrConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (c *fakeRemoteAddrConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+const echoServiceName = "/spanner.internal.testing.EchoService/Echo"
+
+func newEchoServiceDesc(handle func(ctx context.Context)) *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "spanner.internal.testing.EchoService",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Echo",
+				Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+					in := new(emptypb.Empty)
+					if err := dec(in); err != nil {
+						return nil, err
+					}
+					handle(ctx)
+					return &emptypb.Empty{}, nil
+				},
+			},
+		},
+		Streams: []grpc.StreamDesc{},
+	}
+}
+
+// dialThroughFakeDirectPathPeer starts a gRPC server behind an in-memory
+// bufconn listener, wraps the client end of every connection so its
+// RemoteAddr reports a DirectPath-looking address, and dials it with mf's
+// UnaryInterceptor installed. It returns the resulting client conn and a
+// cleanup func.
+func dialThroughFakeDirectPathPeer(t *testing.T, mf *builtinMetricsFactory, handle func(ctx context.Context)) (*grpc.ClientConn, func()) {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+
+	srv := grpc.NewServer()
+	srv.RegisterService(newEchoServiceDesc(handle), nil)
+	go srv.Serve(lis)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, "passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			conn, err := lis.DialContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return &fakeRemoteAddrConn{Conn: conn, remoteAddr: directPathTestAddr{}}, nil
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(mf.UnaryInterceptor()),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		t.Fatalf("grpc.DialContext: %v", err)
+	}
+	return cc, func() {
+		cc.Close()
+		srv.Stop()
+	}
+}
+
+func TestUnaryInterceptorCapturesDirectPathPeerEndToEnd(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+	mf.SetDirectPathEnabled(true)
+
+	cc, cleanup := dialThroughFakeDirectPathPeer(t, mf, func(ctx context.Context) {})
+	defer cleanup()
+
+	ot := &operationTracker{}
+	now := time.Now()
+	ctx := ot.startAttempt(context.Background(), nil, echoServiceName, "session1", "", now)
+
+	if err := cc.Invoke(ctx, echoServiceName, &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	mf.RecordAttempt(ctx, ot, echoServiceName, nil, now.Add(time.Millisecond))
+
+	AssertMetric(t, reader, metricNameAttemptLatencies, []attribute.KeyValue{
+		attribute.Bool(metricLabelKeyDirectPathUsed, true),
+	}, func(t *testing.T, points []MetricPoint) {
+		if len(points) == 0 {
+			t.Errorf("attempt_latencies: no data point with directpath_used=true; peer capture in UnaryInterceptor didn't propagate")
+		}
+	})
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func newTestMetricsFactory(t *testing.T) (*builtinMetricsFactory, *sdkmetric.ManualReader) {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	mf, err := newBuiltinMetricsTracerFactory(context.Background(), "project", "instance", "config", false, MetricsProviderForTest{Reader: reader})
+	if err != nil {
+		t.Fatalf("newBuiltinMetricsTracerFactory: %v", err)
+	}
+	return mf, reader
+}
+
+func TestCreateInstruments(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+
+	mf.attemptLatencies.Record(context.Background(), 1)
+	mf.operationLatencies.Record(context.Background(), 1)
+	mf.attemptCount.Add(context.Background(), 1)
+	mf.operationCount.Add(context.Background(), 1)
+	mf.gfeLatencies.Record(context.Background(), 1)
+	mf.afeLatencies.Record(context.Background(), 1)
+	mf.gfeMissingHeaderCount.Add(context.Background(), 1)
+
+	for _, name := range []string{
+		metricNameAttemptLatencies,
+		metricNameOperationLatencies,
+		metricNameAttemptCount,
+		metricNameOperationCount,
+		metricNameGFELatencies,
+		metricNameAFELatencies,
+		metricNameGFEMissingHeaderCount,
+	} {
+		AssertMetric(t, reader, name, nil, func(t *testing.T, points []MetricPoint) {
+			if len(points) != 1 {
+				t.Errorf("%s: got %d points, want 1", name, len(points))
+			}
+		})
+	}
+}
+
+// simulateReadWriteTransaction drives mf and an operationTracker through a
+// two-attempt operation, mirroring what ReadWriteTransaction's retry loop
+// would do: start the operation, run two attempts (the first failing), then
+// close out the operation.
+func simulateReadWriteTransaction(mf *builtinMetricsFactory) {
+	ot := &operationTracker{}
+	now := time.Now()
+	ctx := ot.startOperation(context.Background(), nil, "ReadWriteTransaction", now)
+
+	ctx1 := ot.startAttempt(ctx, nil, "ExecuteSql", "session1", "", now)
+	mf.RecordAttempt(ctx1, ot, "ExecuteSql", context.DeadlineExceeded, now.Add(5*time.Millisecond))
+
+	ctx2 := ot.startAttempt(ctx, nil, "ExecuteSql", "session1", "", now.Add(5*time.Millisecond))
+	mf.RecordAttempt(ctx2, ot, "ExecuteSql", nil, now.Add(15*time.Millisecond))
+
+	mf.RecordOperation(ctx, ot, "ReadWriteTransaction", nil, now.Add(15*time.Millisecond))
+}
+
+func TestReadWriteTransactionRecordsTwoAttemptsOneOperation(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+
+	simulateReadWriteTransaction(mf)
+
+	var clientUID string
+	for _, kv := range mf.clientAttributes {
+		if kv.Key == metricLabelKeyClientUID {
+			clientUID = kv.Value.AsString()
+		}
+	}
+
+	AssertMetric(t, reader, metricNameAttemptLatencies, []attribute.KeyValue{
+		attribute.String(metricLabelKeyClientUID, clientUID),
+	}, func(t *testing.T, points []MetricPoint) {
+		var total uint64
+		for _, p := range points {
+			total += p.Count
+		}
+		if total != 2 {
+			t.Errorf("attempt_latencies: got %d samples, want 2", total)
+		}
+	})
+
+	AssertMetric(t, reader, metricNameOperationLatencies, []attribute.KeyValue{
+		attribute.String(metricLabelKeyClientUID, clientUID),
+	}, func(t *testing.T, points []MetricPoint) {
+		var total uint64
+		for _, p := range points {
+			total += p.Count
+		}
+		if total != 1 {
+			t.Errorf("operation_latencies: got %d samples, want 1", total)
+		}
+	})
+}
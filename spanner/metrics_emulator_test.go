@@ -0,0 +1,77 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestNewBuiltinMetricsTracerFactory_EmulatorDisablesMetrics(t *testing.T) {
+	os.Setenv(spannerEmulatorHostEnvVar, "localhost:9010")
+	defer os.Unsetenv(spannerEmulatorHostEnvVar)
+
+	mf, err := newBuiltinMetricsTracerFactory(context.Background(), "project", "instance", "config", false, nil)
+	if err != nil {
+		t.Fatalf("newBuiltinMetricsTracerFactory: %v", err)
+	}
+	if mf.builtinEnabled {
+		t.Errorf("builtinEnabled = true when %s is set, want false", spannerEmulatorHostEnvVar)
+	}
+}
+
+func TestNewBuiltinMetricsTracerFactory_DisableEnvVar(t *testing.T) {
+	os.Setenv(disableBuiltinMetricsEnvVar, "true")
+	defer os.Unsetenv(disableBuiltinMetricsEnvVar)
+
+	mf, err := newBuiltinMetricsTracerFactory(context.Background(), "project", "instance", "config", false, nil)
+	if err != nil {
+		t.Fatalf("newBuiltinMetricsTracerFactory: %v", err)
+	}
+	if mf.builtinEnabled {
+		t.Errorf("builtinEnabled = true when %s is set, want false", disableBuiltinMetricsEnvVar)
+	}
+}
+
+func TestNewBuiltinMetricsTracerFactory_DisableOption(t *testing.T) {
+	mf, err := newBuiltinMetricsTracerFactory(context.Background(), "project", "instance", "config", true, nil)
+	if err != nil {
+		t.Fatalf("newBuiltinMetricsTracerFactory: %v", err)
+	}
+	if mf.builtinEnabled {
+		t.Errorf("builtinEnabled = true when disableBuiltinMetrics is true, want false")
+	}
+}
+
+func TestNewBuiltinMetricsTracerFactory_CustomProviderOverridesEmulator(t *testing.T) {
+	os.Setenv(spannerEmulatorHostEnvVar, "localhost:9010")
+	defer os.Unsetenv(spannerEmulatorHostEnvVar)
+
+	mp := sdkmetric.NewMeterProvider()
+	defer mp.Shutdown(context.Background())
+
+	mf, err := newBuiltinMetricsTracerFactory(context.Background(), "project", "instance", "config", false, CustomOpenTelemetryMetricsProvider{MeterProvider: mp})
+	if err != nil {
+		t.Fatalf("newBuiltinMetricsTracerFactory: %v", err)
+	}
+	if !mf.builtinEnabled {
+		t.Errorf("builtinEnabled = false with a CustomOpenTelemetryMetricsProvider and %s set, want true", spannerEmulatorHostEnvVar)
+	}
+}
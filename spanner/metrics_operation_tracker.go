@@ -0,0 +1,124 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// operationTracker times a single user-facing operation and its RPC
+// attempts. builtinMetricsFactory and builtinTracesFactory are both driven
+// from the same operationTracker. Latencies are computed from the now values
+// passed to its methods; spans are started and ended on the tracer's own
+// clock, so a span's timing is not taken from those readings.
+type operationTracker struct {
+	operationStart time.Time
+	attemptStart   time.Time
+	attemptCount   int
+
+	operationSpan trace.Span
+	attemptSpan   trace.Span
+
+	// attemptPeerAddr is the remote peer UnaryInterceptor or
+	// StreamClientInterceptor captured for the in-flight attempt via the
+	// grpc.Peer call option. It is read by
+	// directPathUsedForAttempt once the attempt completes.
+	attemptPeerAddr net.Addr
+}
+
+// operationTrackerContextKey is the context key an operationTracker is
+// stored under so that UnaryInterceptor, which only sees the outgoing call
+// context, can find the tracker for the attempt it is wrapping.
+type operationTrackerContextKey struct{}
+
+// contextWithOperationTracker returns a context that carries ot, for
+// UnaryInterceptor to retrieve with operationTrackerFromContext.
+func contextWithOperationTracker(ctx context.Context, ot *operationTracker) context.Context {
+	return context.WithValue(ctx, operationTrackerContextKey{}, ot)
+}
+
+// operationTrackerFromContext returns the operationTracker attached to ctx
+// by startAttempt, or nil if there isn't one.
+func operationTrackerFromContext(ctx context.Context) *operationTracker {
+	ot, _ := ctx.Value(operationTrackerContextKey{}).(*operationTracker)
+	return ot
+}
+
+// startOperation opens the root span for the operation (via tf, which may be
+// nil or disabled, in which case ctx is returned unchanged) and starts the
+// operation clock.
+func (ot *operationTracker) startOperation(ctx context.Context, tf *builtinTracesFactory, name string, now time.Time) context.Context {
+	ot.operationStart = now
+	ot.attemptCount = 0
+	if tf == nil {
+		return ctx
+	}
+	ctx, ot.operationSpan = tf.startOperation(ctx, name)
+	return ctx
+}
+
+// startAttempt opens the child span for the next attempt and starts the
+// attempt clock. It returns the (possibly unchanged) context the attempt's
+// RPC should be issued with. The span's directpath_used attribute isn't set
+// here: whether DirectPath was actually used for the attempt is only known
+// once UnaryInterceptor/StreamClientInterceptor have captured its peer
+// address after the RPC completes, so endAttempt sets it instead.
+func (ot *operationTracker) startAttempt(ctx context.Context, tf *builtinTracesFactory, method, sessionID, transactionID string, now time.Time) context.Context {
+	ot.attemptStart = now
+	ot.attemptCount++
+	ot.attemptPeerAddr = nil
+	ctx = contextWithOperationTracker(ctx, ot)
+	if tf == nil {
+		return ctx
+	}
+	ctx, ot.attemptSpan = tf.startAttempt(ctx, method, sessionID, transactionID, ot.attemptCount-1)
+	return ctx
+}
+
+// endAttempt ends the current attempt span, if any, and returns how long the
+// attempt took as measured from now. It sets the span's directpath_used
+// attribute just before ending it, since attemptPeerAddr is only populated
+// once the attempt's RPC has completed.
+func (ot *operationTracker) endAttempt(now time.Time) time.Duration {
+	if ot.attemptSpan != nil {
+		ot.attemptSpan.SetAttributes(attribute.Bool(metricLabelKeyDirectPathUsed, directPathUsedForAttempt(ot)))
+		ot.attemptSpan.End()
+		ot.attemptSpan = nil
+	}
+	return now.Sub(ot.attemptStart)
+}
+
+// endOperation ends the current operation span, if any, and returns how long
+// the overall operation took as measured from now.
+func (ot *operationTracker) endOperation(now time.Time) time.Duration {
+	if ot.operationSpan != nil {
+		ot.operationSpan.End()
+		ot.operationSpan = nil
+	}
+	return now.Sub(ot.operationStart)
+}
+
+// attempts reports the number of attempts started so far for the current
+// operation.
+func (ot *operationTracker) attempts() int {
+	return ot.attemptCount
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// statusFromError returns the gRPC status code name for err, or "OK" if err
+// is nil.
+func statusFromError(err error) string {
+	return status.Code(err).String()
+}
+
+const serverTimingHeader = "server-timing"
+
+// serverTiming holds the latencies parsed out of a server-timing trailer.
+type serverTiming struct {
+	gfeMillis float64
+	hasGFE    bool
+	afeMillis float64
+	hasAFE    bool
+}
+
+// parseServerTiming parses the entries of a server-timing header, e.g.
+// "gfet4t7; dur=12, afe; dur=3". Unrecognized entries are ignored.
+func parseServerTiming(values []string) serverTiming {
+	var st serverTiming
+	for _, header := range values {
+		for _, entry := range strings.Split(header, ",") {
+			parts := strings.Split(entry, ";")
+			name := strings.TrimSpace(parts[0])
+			var dur float64
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || kv[0] != "dur" {
+					continue
+				}
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					dur = v
+				}
+			}
+			switch name {
+			case "gfet4t7":
+				st.gfeMillis, st.hasGFE = dur, true
+			case "afe":
+				st.afeMillis, st.hasAFE = dur, true
+			}
+		}
+	}
+	return st
+}
+
+// recordServerTiming records the GFE/AFE latencies observed in trailer
+// against mf's histograms, tagged with attrs (typically the client and
+// method/status attributes for the attempt), or increments
+// gfeMissingHeaderCount when the trailer carries no server-timing header or
+// one with neither a GFE nor an AFE entry.
+func (mf *builtinMetricsFactory) recordServerTiming(ctx context.Context, trailer metadata.MD, attrs ...attribute.KeyValue) {
+	if !mf.builtinEnabled {
+		return
+	}
+	values := trailer.Get(serverTimingHeader)
+	if len(values) == 0 {
+		mf.gfeMissingHeaderCount.Add(ctx, 1, metric.WithAttributes(attrs...))
+		return
+	}
+	st := parseServerTiming(values)
+	if st.hasGFE {
+		mf.gfeLatencies.Record(ctx, st.gfeMillis, metric.WithAttributes(attrs...))
+	}
+	if st.hasAFE {
+		mf.afeLatencies.Record(ctx, st.afeMillis, metric.WithAttributes(attrs...))
+	}
+	if !st.hasGFE && !st.hasAFE {
+		mf.gfeMissingHeaderCount.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+}
+
+// UnaryInterceptor returns a grpc.UnaryClientInterceptor that reads the
+// server-timing trailer off each unary RPC and records gfe_latencies and
+// afe_latencies (or gfe_missing_header_count when the trailer is absent),
+// tagged with the same attribute set attempt_latencies carries — including
+// the directpath_enabled/directpath_used pair — so the two metric families
+// can be joined and filtered the same way. It also captures the RPC's
+// remote peer via the grpc.Peer call option and, when the context carries
+// the operationTracker for the in-flight attempt, records the peer address
+// there so directPathUsedForAttempt can classify the attempt once
+// RecordAttempt runs — gRPC-go never attaches the client-side peer to the
+// context itself, so this call option is the only way to see it.
+func (mf *builtinMetricsFactory) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var trailer metadata.MD
+		var p peer.Peer
+		opts = append(opts, grpc.Trailer(&trailer), grpc.Peer(&p))
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		ot := operationTrackerFromContext(ctx)
+		if ot != nil && p.Addr != nil {
+			ot.attemptPeerAddr = p.Addr
+		}
+		attrs := append(mf.attemptStatusAttributes(method, err), mf.directPathAttributes(ot)...)
+		mf.recordServerTiming(ctx, trailer, attrs...)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a grpc.StreamClientInterceptor that
+// performs the same server-timing and DirectPath-peer recording as
+// UnaryInterceptor, but for streaming RPCs such as ExecuteStreamingSql and
+// StreamingRead — Spanner's hottest, most latency-sensitive calls, which
+// UnaryInterceptor alone never observes. The trailer and peer are only
+// available once the stream has finished, so recording happens in the
+// returned stream's RecvMsg once it returns a non-nil error (io.EOF on a
+// clean close, or the RPC's actual failure).
+func (mf *builtinMetricsFactory) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		var p peer.Peer
+		opts = append(opts, grpc.Peer(&p))
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &serverTimingClientStream{ClientStream: cs, mf: mf, ctx: ctx, method: method, peer: &p}, nil
+	}
+}
+
+// serverTimingClientStream wraps a grpc.ClientStream so that its
+// server-timing trailer and DirectPath peer are recorded exactly once, the
+// same way UnaryInterceptor records them for unary RPCs, once the stream
+// ends.
+type serverTimingClientStream struct {
+	grpc.ClientStream
+	mf     *builtinMetricsFactory
+	ctx    context.Context
+	method string
+	peer   *peer.Peer
+
+	recorded bool
+}
+
+func (s *serverTimingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.record(err)
+	}
+	return err
+}
+
+// record records the stream's server-timing trailer and peer address,
+// treating a plain io.EOF (the normal way a stream ends) as a successful
+// status.
+func (s *serverTimingClientStream) record(err error) {
+	if s.recorded {
+		return
+	}
+	s.recorded = true
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	ot := operationTrackerFromContext(s.ctx)
+	if ot != nil && s.peer.Addr != nil {
+		ot.attemptPeerAddr = s.peer.Addr
+	}
+	attrs := append(s.mf.attemptStatusAttributes(s.method, err), s.mf.directPathAttributes(ot)...)
+	s.mf.recordServerTiming(s.ctx, s.ClientStream.Trailer(), attrs...)
+}
+
+// attemptStatusAttributes returns the client attributes plus method/status
+// labels used to tag attempt-scoped metrics such as gfe_latencies.
+func (mf *builtinMetricsFactory) attemptStatusAttributes(method string, err error) []attribute.KeyValue {
+	attrs := append([]attribute.KeyValue{}, mf.clientAttributes...)
+	attrs = append(attrs,
+		attribute.String(metricLabelKeyMethod, method),
+		attribute.String(metricLabelKeyOperationStatus, statusFromError(err)),
+	)
+	return attrs
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeUnaryInvoker returns a grpc.UnaryInvoker that, instead of issuing a
+// real RPC, fills in whatever grpc.Trailer/grpc.Peer call options
+// UnaryInterceptor attached and returns invokeErr. This exercises
+// UnaryInterceptor's recording logic directly, without a network round trip.
+func fakeUnaryInvoker(trailer metadata.MD, peerAddr net.Addr, invokeErr error) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		for _, opt := range opts {
+			switch o := opt.(type) {
+			case grpc.TrailerCallOption:
+				*o.TrailerAddr = trailer
+			case grpc.PeerCallOption:
+				if peerAddr != nil {
+					o.PeerAddr.Addr = peerAddr
+				}
+			}
+		}
+		return invokeErr
+	}
+}
+
+func TestUnaryInterceptor_RecordsGFEAndAFELatencies(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+	interceptor := mf.UnaryInterceptor()
+
+	trailer := metadata.Pairs(serverTimingHeader, "gfet4t7; dur=12, afe; dur=3")
+	err := interceptor(context.Background(), "Echo", nil, nil, nil, fakeUnaryInvoker(trailer, nil, nil))
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+
+	AssertMetric(t, reader, metricNameGFELatencies, nil, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 || points[0].Sum != 12 {
+			t.Errorf("gfe_latencies: got %+v, want a single point summing to 12", points)
+		}
+	})
+	AssertMetric(t, reader, metricNameAFELatencies, nil, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 || points[0].Sum != 3 {
+			t.Errorf("afe_latencies: got %+v, want a single point summing to 3", points)
+		}
+	})
+}
+
+func TestUnaryInterceptor_MissingServerTimingHeaderIncrementsCounter(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+	interceptor := mf.UnaryInterceptor()
+
+	err := interceptor(context.Background(), "Echo", nil, nil, nil, fakeUnaryInvoker(nil, nil, nil))
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+
+	AssertMetric(t, reader, metricNameGFEMissingHeaderCount, nil, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 || points[0].Count != 1 {
+			t.Errorf("gfe_missing_header_count: got %+v, want a single point with count 1", points)
+		}
+	})
+}
+
+func TestUnaryInterceptor_NoopWhenBuiltinDisabled(t *testing.T) {
+	mf := &builtinMetricsFactory{} // builtinEnabled defaults to false
+	interceptor := mf.UnaryInterceptor()
+
+	invoked := false
+	err := interceptor(context.Background(), "Echo", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+	if !invoked {
+		t.Fatalf("interceptor did not call through to the invoker")
+	}
+	// mf is a zero value, so its histograms/counters are nil and
+	// recordServerTiming must have returned before touching them; reaching
+	// this point without a nil pointer panic is the assertion.
+}
+
+func TestUnaryInterceptor_IncludesDirectPathAttributes(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+	mf.SetDirectPathEnabled(true)
+	interceptor := mf.UnaryInterceptor()
+
+	ot := &operationTracker{}
+	ctx := ot.startAttempt(context.Background(), nil, "Echo", "session1", "", time.Now())
+
+	trailer := metadata.Pairs(serverTimingHeader, "gfet4t7; dur=1")
+	directPathAddr := &net.TCPAddr{IP: net.ParseIP("34.126.1.1"), Port: 443}
+	if err := interceptor(ctx, "Echo", nil, nil, nil, fakeUnaryInvoker(trailer, directPathAddr, nil)); err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+
+	AssertMetric(t, reader, metricNameGFELatencies, []attribute.KeyValue{
+		attribute.Bool(metricLabelKeyDirectPathEnabled, true),
+		attribute.Bool(metricLabelKeyDirectPathUsed, true),
+	}, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 {
+			t.Errorf("gfe_latencies: got %d points tagged with directpath attributes, want 1", len(points))
+		}
+	})
+}
+
+// fakeClientStream implements grpc.ClientStream around a canned trailer and
+// RecvMsg error, so StreamClientInterceptor can be exercised without a
+// network round trip.
+type fakeClientStream struct {
+	trailer metadata.MD
+	recvErr error
+}
+
+func (s *fakeClientStream) Header() (metadata.MD, error) { return nil, nil }
+func (s *fakeClientStream) Trailer() metadata.MD         { return s.trailer }
+func (s *fakeClientStream) CloseSend() error             { return nil }
+func (s *fakeClientStream) Context() context.Context     { return context.Background() }
+func (s *fakeClientStream) SendMsg(m interface{}) error  { return nil }
+func (s *fakeClientStream) RecvMsg(m interface{}) error  { return s.recvErr }
+
+func fakeStreamer(trailer metadata.MD, recvErr error, peerAddr net.Addr) grpc.Streamer {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		for _, opt := range opts {
+			if o, ok := opt.(grpc.PeerCallOption); ok && peerAddr != nil {
+				o.PeerAddr.Addr = peerAddr
+			}
+		}
+		return &fakeClientStream{trailer: trailer, recvErr: recvErr}, nil
+	}
+}
+
+func TestStreamClientInterceptor_RecordsGFEAndAFELatencies(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+	interceptor := mf.StreamClientInterceptor()
+
+	trailer := metadata.Pairs(serverTimingHeader, "gfet4t7; dur=12, afe; dur=3")
+	cs, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "ExecuteStreamingSql", fakeStreamer(trailer, io.EOF, nil))
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+	if err := cs.RecvMsg(nil); err != io.EOF {
+		t.Fatalf("RecvMsg: got %v, want io.EOF", err)
+	}
+
+	AssertMetric(t, reader, metricNameGFELatencies, nil, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 || points[0].Sum != 12 {
+			t.Errorf("gfe_latencies: got %+v, want a single point summing to 12", points)
+		}
+	})
+	AssertMetric(t, reader, metricNameAFELatencies, nil, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 || points[0].Sum != 3 {
+			t.Errorf("afe_latencies: got %+v, want a single point summing to 3", points)
+		}
+	})
+}
+
+func TestStreamClientInterceptor_MissingServerTimingHeaderIncrementsCounter(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+	interceptor := mf.StreamClientInterceptor()
+
+	cs, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "ExecuteStreamingSql", fakeStreamer(nil, io.EOF, nil))
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+	cs.RecvMsg(nil)
+
+	AssertMetric(t, reader, metricNameGFEMissingHeaderCount, nil, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 || points[0].Count != 1 {
+			t.Errorf("gfe_missing_header_count: got %+v, want a single point with count 1", points)
+		}
+	})
+}
+
+func TestStreamClientInterceptor_RecordsOnlyOnce(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+	interceptor := mf.StreamClientInterceptor()
+
+	trailer := metadata.Pairs(serverTimingHeader, "gfet4t7; dur=1")
+	cs, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "ExecuteStreamingSql", fakeStreamer(trailer, io.EOF, nil))
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+	cs.RecvMsg(nil)
+	cs.RecvMsg(nil)
+
+	AssertMetric(t, reader, metricNameGFELatencies, nil, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 || points[0].Count != 1 {
+			t.Errorf("gfe_latencies: got %+v after two RecvMsg calls, want a single point with count 1", points)
+		}
+	})
+}
+
+func TestStreamClientInterceptor_IncludesDirectPathAttributes(t *testing.T) {
+	mf, reader := newTestMetricsFactory(t)
+	mf.SetDirectPathEnabled(true)
+	interceptor := mf.StreamClientInterceptor()
+
+	ot := &operationTracker{}
+	ctx := ot.startAttempt(context.Background(), nil, "ExecuteStreamingSql", "session1", "", time.Now())
+
+	trailer := metadata.Pairs(serverTimingHeader, "gfet4t7; dur=1")
+	directPathAddr := &net.TCPAddr{IP: net.ParseIP("34.126.1.1"), Port: 443}
+	cs, err := interceptor(ctx, &grpc.StreamDesc{}, nil, "ExecuteStreamingSql", fakeStreamer(trailer, io.EOF, directPathAddr))
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+	cs.RecvMsg(nil)
+
+	AssertMetric(t, reader, metricNameGFELatencies, []attribute.KeyValue{
+		attribute.Bool(metricLabelKeyDirectPathEnabled, true),
+		attribute.Bool(metricLabelKeyDirectPathUsed, true),
+	}, func(t *testing.T, points []MetricPoint) {
+		if len(points) != 1 {
+			t.Errorf("gfe_latencies: got %d points tagged with directpath attributes, want 1", len(points))
+		}
+	})
+}
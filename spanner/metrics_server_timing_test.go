@@ -0,0 +1,65 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import "testing"
+
+func TestParseServerTiming(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		values     []string
+		wantGFE    float64
+		wantHasGFE bool
+		wantAFE    float64
+		wantHasAFE bool
+	}{
+		{
+			name:       "both present",
+			values:     []string{"gfet4t7; dur=12, afe; dur=3"},
+			wantGFE:    12,
+			wantHasGFE: true,
+			wantAFE:    3,
+			wantHasAFE: true,
+		},
+		{
+			name:       "only gfe",
+			values:     []string{"gfet4t7; dur=42"},
+			wantGFE:    42,
+			wantHasGFE: true,
+		},
+		{
+			name:   "unrecognized entry",
+			values: []string{"cache; desc=\"hit\""},
+		},
+		{
+			name:       "split across repeated headers",
+			values:     []string{"gfet4t7; dur=5", "afe; dur=7"},
+			wantGFE:    5,
+			wantHasGFE: true,
+			wantAFE:    7,
+			wantHasAFE: true,
+		},
+	} {
+		got := parseServerTiming(tc.values)
+		if got.gfeMillis != tc.wantGFE || got.hasGFE != tc.wantHasGFE {
+			t.Errorf("%s: gfe = (%v, %v), want (%v, %v)", tc.name, got.gfeMillis, got.hasGFE, tc.wantGFE, tc.wantHasGFE)
+		}
+		if got.afeMillis != tc.wantAFE || got.hasAFE != tc.wantHasAFE {
+			t.Errorf("%s: afe = (%v, %v), want (%v, %v)", tc.name, got.afeMillis, got.hasAFE, tc.wantAFE, tc.wantHasAFE)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// MetricPoint is a reader-agnostic view of a single histogram or counter
+// data point, as returned by AssertMetric.
+type MetricPoint struct {
+	Attributes attribute.Set
+	Count      uint64
+	Sum        float64
+}
+
+// findMetric flushes reader and returns the metricdata.Metrics recorded
+// under nativeMetricsPrefix+name, or nil if nothing has been recorded yet.
+func findMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) *metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("reader.Collect: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for i := range sm.Metrics {
+			if sm.Metrics[i].Name == nativeMetricsPrefix+name {
+				return &sm.Metrics[i]
+			}
+		}
+	}
+	return nil
+}
+
+// metricPoints extracts MetricPoints out of the histogram or counter
+// aggregation held by m.Data.
+func metricPoints(m metricdata.Metrics) []MetricPoint {
+	switch a := m.Data.(type) {
+	case metricdata.Histogram[float64]:
+		points := make([]MetricPoint, len(a.DataPoints))
+		for i, dp := range a.DataPoints {
+			points[i] = MetricPoint{Attributes: dp.Attributes, Count: dp.Count, Sum: dp.Sum}
+		}
+		return points
+	case metricdata.Sum[int64]:
+		points := make([]MetricPoint, len(a.DataPoints))
+		for i, dp := range a.DataPoints {
+			points[i] = MetricPoint{Attributes: dp.Attributes, Count: uint64(dp.Value)}
+		}
+		return points
+	default:
+		return nil
+	}
+}
+
+// attrSetHasAll reports whether every key/value in want is present in set.
+func attrSetHasAll(set, want attribute.Set) bool {
+	for _, kv := range want.ToSlice() {
+		v, ok := set.Value(kv.Key)
+		if !ok || v != kv.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertMetric flushes reader, looks up the instrument named
+// nativeMetricsPrefix+name, filters its data points down to the ones whose
+// attributes are a superset of wantAttrs, and hands the result to matcher.
+// It fails the test if the instrument hasn't recorded anything yet.
+func AssertMetric(t *testing.T, reader *sdkmetric.ManualReader, name string, wantAttrs []attribute.KeyValue, matcher func(t *testing.T, points []MetricPoint)) {
+	t.Helper()
+	m := findMetric(t, reader, name)
+	if m == nil {
+		t.Fatalf("metric %s%s: no data recorded", nativeMetricsPrefix, name)
+	}
+	points := metricPoints(*m)
+	if len(wantAttrs) > 0 {
+		want := attribute.NewSet(wantAttrs...)
+		var filtered []MetricPoint
+		for _, p := range points {
+			if attrSetHasAll(p.Attributes, want) {
+				filtered = append(filtered, p)
+			}
+		}
+		points = filtered
+	}
+	matcher(t, points)
+}
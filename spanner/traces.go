@@ -0,0 +1,113 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "cloud.google.com/go/spanner"
+
+	// Span attribute keys.
+	traceAttrKeySessionID     = "gcp.spanner.session_id"
+	traceAttrKeyTransactionID = "gcp.spanner.transaction_id"
+	traceAttrKeyRetryCount    = "gcp.spanner.retry_count"
+)
+
+// TracesProvider is a wrapper for the built-in tracing tracer provider. It
+// plays the same role for spans that MetricsProvider plays for metrics.
+type TracesProvider interface {
+	isTracesProvider()
+}
+
+// NoopTracesProvider can be used to disable built-in tracing.
+type NoopTracesProvider struct{}
+
+func (NoopTracesProvider) isTracesProvider() {}
+
+// CustomOpenTelemetryTracesProvider can be used to export built-in traces
+// through a user-supplied TracerProvider.
+type CustomOpenTelemetryTracesProvider struct {
+	TracerProvider trace.TracerProvider
+}
+
+func (CustomOpenTelemetryTracesProvider) isTracesProvider() {}
+
+// builtinTracesFactory creates the root span for each user-facing operation
+// and the child spans for its RPC attempts.
+type builtinTracesFactory struct {
+	tracesEnabled bool
+	tracer        trace.Tracer
+
+	// attributes that are specific to a client instance and do not change
+	// across different function calls on client.
+	clientAttributes []attribute.KeyValue
+}
+
+func newBuiltinTracesFactory(project, instance, instanceConfig string, tracesProvider TracesProvider) *builtinTracesFactory {
+	tf := &builtinTracesFactory{
+		clientAttributes: []attribute.KeyValue{
+			attribute.String(monitoredResLabelKeyProject, project),
+			attribute.String(monitoredResLabelKeyInstance, instance),
+			attribute.String(monitoredResLabelKeyInstanceConfig, instanceConfig),
+		},
+	}
+
+	var tracerProvider trace.TracerProvider
+	switch v := tracesProvider.(type) {
+	case CustomOpenTelemetryTracesProvider:
+		tf.tracesEnabled = true
+		tracerProvider = v.TracerProvider
+	case NoopTracesProvider, nil:
+		return tf
+	default:
+		return tf
+	}
+
+	tf.tracer = tracerProvider.Tracer(tracerName)
+	return tf
+}
+
+// startOperation opens the root span for a user-facing operation such as
+// Spanner.ReadWriteTransaction. It returns ctx unchanged when tracing is
+// disabled, so callers can call span.End unconditionally.
+func (tf *builtinTracesFactory) startOperation(ctx context.Context, name string) (context.Context, trace.Span) {
+	if !tf.tracesEnabled {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return tf.tracer.Start(ctx, "Spanner."+name, trace.WithAttributes(tf.clientAttributes...))
+}
+
+// startAttempt opens a child span for a single RPC attempt within the
+// operation started by startOperation, annotated with the session,
+// transaction and retry information callers already track per attempt. The
+// span's directpath_used attribute is added later, by operationTracker's
+// endAttempt, once it's actually known.
+func (tf *builtinTracesFactory) startAttempt(ctx context.Context, method, sessionID, transactionID string, retryCount int) (context.Context, trace.Span) {
+	if !tf.tracesEnabled {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return tf.tracer.Start(ctx, method, trace.WithAttributes(
+		attribute.String(traceAttrKeySessionID, sessionID),
+		attribute.String(traceAttrKeyTransactionID, transactionID),
+		attribute.Int(traceAttrKeyRetryCount, retryCount),
+	))
+}
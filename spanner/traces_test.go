@@ -0,0 +1,109 @@
+/*
+Copyright 2024 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestBuiltinTracesFactory_Noop(t *testing.T) {
+	tf := newBuiltinTracesFactory("project", "instance", "config", NoopTracesProvider{})
+	if tf.tracesEnabled {
+		t.Errorf("tracesEnabled = true with NoopTracesProvider, want false")
+	}
+	ctx, span := tf.startOperation(context.Background(), "ReadWriteTransaction")
+	if ctx == nil || span == nil {
+		t.Fatalf("startOperation returned nil ctx or span")
+	}
+}
+
+func TestBuiltinTracesFactory_RecordsSpans(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	defer tp.Shutdown(context.Background())
+
+	tf := newBuiltinTracesFactory("project", "instance", "config", CustomOpenTelemetryTracesProvider{TracerProvider: tp})
+	if !tf.tracesEnabled {
+		t.Fatalf("tracesEnabled = false with CustomOpenTelemetryTracesProvider, want true")
+	}
+
+	ot := &operationTracker{}
+	now := time.Now()
+	ctx := ot.startOperation(context.Background(), tf, "ReadWriteTransaction", now)
+	ctx = ot.startAttempt(ctx, tf, "ExecuteSql", "session1", "txn1", now)
+	ot.endAttempt(now.Add(10 * time.Millisecond))
+	ot.endOperation(now.Add(10 * time.Millisecond))
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d ended spans, want 2", len(spans))
+	}
+	if spans[0].Name() != "ExecuteSql" {
+		t.Errorf("attempt span name = %q, want %q", spans[0].Name(), "ExecuteSql")
+	}
+	if spans[1].Name() != "Spanner.ReadWriteTransaction" {
+		t.Errorf("operation span name = %q, want %q", spans[1].Name(), "Spanner.ReadWriteTransaction")
+	}
+
+	var gotDirectPathUsed, hasDirectPathUsed bool
+	for _, kv := range spans[0].Attributes() {
+		if string(kv.Key) == metricLabelKeyDirectPathUsed {
+			gotDirectPathUsed, hasDirectPathUsed = kv.Value.AsBool(), true
+		}
+	}
+	if !hasDirectPathUsed {
+		t.Fatalf("attempt span has no %s attribute; endAttempt should set it once the attempt completes", metricLabelKeyDirectPathUsed)
+	}
+	if gotDirectPathUsed {
+		t.Errorf("%s = true for an attempt with no captured peer, want false", metricLabelKeyDirectPathUsed)
+	}
+}
+
+func TestBuiltinTracesFactory_RecordsDirectPathUsedOnAttemptSpan(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	defer tp.Shutdown(context.Background())
+
+	tf := newBuiltinTracesFactory("project", "instance", "config", CustomOpenTelemetryTracesProvider{TracerProvider: tp})
+
+	ot := &operationTracker{}
+	now := time.Now()
+	ctx := ot.startAttempt(context.Background(), tf, "ExecuteSql", "session1", "txn1", now)
+	_ = ctx
+	ot.attemptPeerAddr = directPathTestAddr{}
+	ot.endAttempt(now.Add(10 * time.Millisecond))
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d ended spans, want 1", len(spans))
+	}
+	for _, kv := range spans[0].Attributes() {
+		if string(kv.Key) == metricLabelKeyDirectPathUsed {
+			if !kv.Value.AsBool() {
+				t.Errorf("%s = false with a DirectPath peer address, want true", metricLabelKeyDirectPathUsed)
+			}
+			return
+		}
+	}
+	t.Fatalf("attempt span has no %s attribute", metricLabelKeyDirectPathUsed)
+}